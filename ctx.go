@@ -15,16 +15,35 @@ type H struct {
 	quitch   chan struct{}
 	quitOnce sync.Once
 	wg       sync.WaitGroup
+
+	regMu  sync.Mutex
+	nextID uint64
+	regs   map[uint64]func() bool
+
+	errs errs
+
+	phaseMu sync.Mutex
+	phaseWG map[int]*sync.WaitGroup
+
+	panicHandler func(recovered any, stack []byte)
 }
 
 // New creates H with a child context from ctx.
 // If ctx is nil, a runtime panic will be produced.
-func New(ctx context.Context) *H {
+//
+// Options can be passed to configure H, see WithPanicHandler.
+func New(ctx context.Context, opts ...Option) *H {
 	if ctx == nil {
 		panic("ctxhelper: nil context not permitted")
 	}
 	h := &H{
-		quitch: make(chan struct{}),
+		quitch:       make(chan struct{}),
+		regs:         make(map[uint64]func() bool),
+		phaseWG:      make(map[int]*sync.WaitGroup),
+		panicHandler: defaultPanicHandler,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
 	h.ctx, h.cancel = context.WithCancel(ctx)
 	return h
@@ -38,10 +57,15 @@ func New(ctx context.Context) *H {
 // If ctx is already canceled or H is terminated via Quit,
 // calling OnDone will be a no op.
 //
-// Each call to OnDone will wait for ctx cancellation and function execution, or a call to Quit, in its own goroutine.
-// OnDone is a non-blocking call.
+// OnDone is a non-blocking call. On Go 1.21 and later, fn is registered via
+// context.AfterFunc instead of parking a dedicated goroutine, which keeps
+// the idle cost of a registration O(1) even when thousands of callbacks
+// are registered. Older toolchains fall back to one goroutine per call.
 //
-// fn must not panic. Any panic recovery is up to the caller of OnDone to implement.
+// A panic raised by fn is recovered and, by default, logged via
+// log.Printf; pass WithPanicHandler to New to handle it instead. Either
+// way, fn's WaitGroup accounting completes normally, so a panicking fn
+// cannot make Wait deadlock.
 //
 // When ctx is canceled, fn will be executed as many times as OnDone has been called,
 // but each fn is not executed in any predetermined order.
@@ -49,20 +73,28 @@ func New(ctx context.Context) *H {
 // Once OnDone is called, any functions being executed on ctx cancellation cannot be removed.
 // Before any functions are executed via context cancellation,
 // you can quit all function termination by calling Quit.
+//
+// OnDone registers fn in phase 0; see OnDonePhase to sequence shutdown
+// across multiple phases.
 func (h *H) OnDone(fn func()) {
+	h.OnDonePhase(0, fn)
+}
+
+// OnDoneCancel behaves like OnDone, but returns a cancel handle for fn,
+// matching the shape of context.AfterFunc's own stop: calling cancel
+// unregisters fn and reports true if fn had not yet started, false
+// otherwise. Unlike OnDone, a registration made through OnDoneCancel can
+// be removed without affecting any other registration. Like OnDone, fn
+// is registered in phase 0, and participates in the same phase-0 barrier
+// as every other phase-0 registration; see OnDonePhase.
+//
+// If ctx is already canceled or H is terminated via Quit, OnDoneCancel
+// is a no op and the returned cancel always reports false.
+func (h *H) OnDoneCancel(fn func()) (cancel func() bool) {
 	if h.IsDone() || h.IsQuit() {
-		return
+		return func() bool { return false }
 	}
-	h.wg.Add(1)
-	go func() {
-		defer h.wg.Done()
-		select {
-		case <-h.ctx.Done(): // wait for context cancellation
-			fn()
-		case <-h.quitch:
-			return
-		}
-	}()
+	return h.addPhase(0, fn)
 }
 
 // IsDone returns true if the context has been canceled, false if not.
@@ -90,6 +122,7 @@ func (h *H) IsQuit() bool {
 func (h *H) Quit() {
 	h.quitOnce.Do(func() {
 		close(h.quitch)
+		h.cancelAll()
 	})
 }
 
@@ -115,13 +148,40 @@ func (h *H) Wait() {
 	h.wg.Wait()
 }
 
+// WaitContext waits like Wait, but returns early with waitCtx.Err() if
+// waitCtx is done first. Callbacks that are still running are not
+// interrupted: waitCtx only unblocks the caller, it does not cancel
+// anything on h. This is the standard pattern for bounding a graceful
+// shutdown with a timeout, e.g. alongside srv.Shutdown(timeoutCtx).
+func (h *H) WaitContext(waitCtx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.wg.Wait()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-waitCtx.Done():
+		return waitCtx.Err()
+	}
+}
+
+// CancelAndWaitContext cancels ctx, then waits like WaitContext, returning
+// early with waitCtx.Err() if waitCtx is done first.
+func (h *H) CancelAndWaitContext(waitCtx context.Context) error {
+	h.Cancel()
+	return h.WaitContext(waitCtx)
+}
+
 // Context returns the underlying context within H.
 func (h *H) Context() context.Context {
 	return h.ctx
 }
 
-// Close cancels ctx and waits for function execution, making H usable as an io.Closer.
+// Close cancels ctx and waits for function execution, making H usable as an
+// io.Closer. It returns the errors collected from any OnDoneErr
+// registrations, joined via errors.Join, or nil if there were none.
 func (h *H) Close() error {
-	h.CancelAndWait()
-	return nil
+	return h.CancelAndWaitErr()
 }
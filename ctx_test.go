@@ -2,8 +2,10 @@ package ctxhelper
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestPanicOnNewWithNilContext(t *testing.T) {
@@ -115,3 +117,186 @@ func TestQuitCallMultiple(t *testing.T) {
 	}
 	t.Log("no panic occurred")
 }
+
+func TestQuitClearsRegistry(t *testing.T) {
+	h := New(context.Background())
+	h.OnDone(func() {})
+	h.OnDone(func() {})
+	h.QuitAndWait()
+
+	h.regMu.Lock()
+	n := len(h.regs)
+	h.regMu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected registry to be empty after Quit, got %d entries", n)
+	}
+}
+
+func TestOnDoneCancel(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	h := New(context.Background())
+	h.OnDone(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+	})
+	cancel := h.OnDoneCancel(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		count++
+	})
+	if !cancel() {
+		t.Fatal("expected cancel to report true before ctx is canceled")
+	}
+	if cancel() {
+		t.Fatal("expected repeat cancel to report false")
+	}
+	h.CancelAndWait()
+	mu.Lock()
+	num := count
+	mu.Unlock()
+	if num != 1 {
+		t.Fatalf("expected 1, got %d: canceled registration must not run, other registrations must be unaffected", num)
+	}
+}
+
+func TestOnDoneErr(t *testing.T) {
+	errA := errors.New("a failed")
+	errB := errors.New("b failed")
+	h := New(context.Background())
+	h.OnDoneErr(func() error {
+		return errA
+	})
+	h.OnDoneErr(func() error {
+		return nil
+	})
+	h.OnDoneErr(func() error {
+		return errB
+	})
+	err := h.CancelAndWaitErr()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Fatalf("expected joined error to wrap both errA and errB, got %v", err)
+	}
+}
+
+func TestOnDonePhase(t *testing.T) {
+	var mu sync.Mutex
+	var order []int
+	record := func(phase int) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, phase)
+	}
+
+	h := New(context.Background())
+	h.OnDonePhase(2, func() { record(2) })
+	h.OnDone(func() { record(0) })
+	h.Phase(1).OnDone(func() { record(1) })
+	h.OnDonePhase(0, func() { record(0) })
+	h.CancelAndWait()
+
+	mu.Lock()
+	got := append([]int(nil), order...)
+	mu.Unlock()
+
+	if len(got) != 4 {
+		t.Fatalf("expected 4 recorded phases, got %v", got)
+	}
+	// The two phase-0 callbacks may run in either order relative to each
+	// other, but both must precede phase 1, which must precede phase 2.
+	for i, phase := range got {
+		if phase == 1 && i < 2 {
+			t.Fatalf("phase 1 ran before both phase 0 callbacks completed: %v", got)
+		}
+		if phase == 2 && i < 3 {
+			t.Fatalf("phase 2 ran before phase 1 completed: %v", got)
+		}
+	}
+}
+
+func TestOnDoneCancelAndOnDoneErrJoinPhaseZero(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, name)
+	}
+
+	release := make(chan struct{})
+	h := New(context.Background())
+	h.OnDoneCancel(func() {
+		<-release
+		record("cancel")
+	})
+	h.OnDoneErr(func() error {
+		<-release
+		record("err")
+		return nil
+	})
+	h.OnDonePhase(1, func() { record("phase1") })
+
+	h.Cancel()
+	time.Sleep(10 * time.Millisecond) // give phase 1 a chance to jump the gun
+	close(release)
+	h.Wait()
+
+	mu.Lock()
+	got := append([]string(nil), order...)
+	mu.Unlock()
+
+	if len(got) != 3 || got[2] != "phase1" {
+		t.Fatalf("expected phase 1 to run last, after both phase-0 registrations, got %v", got)
+	}
+}
+
+func TestWaitContext(t *testing.T) {
+	h := New(context.Background())
+	h.OnDone(func() {})
+	if err := h.CancelAndWaitContext(context.Background()); err != nil {
+		t.Fatalf("expected nil error once callbacks complete, got %v", err)
+	}
+}
+
+func TestWaitContextTimeout(t *testing.T) {
+	release := make(chan struct{})
+	h := New(context.Background())
+	h.OnDone(func() {
+		<-release
+	})
+	defer close(release)
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := h.CancelAndWaitContext(waitCtx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestWithPanicHandler(t *testing.T) {
+	var mu sync.Mutex
+	var recovered any
+	var stackLen int
+	h := New(context.Background(), WithPanicHandler(func(r any, stack []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		recovered = r
+		stackLen = len(stack)
+	}))
+	h.OnDone(func() {
+		panic("boom")
+	})
+	h.CancelAndWait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if recovered != "boom" {
+		t.Fatalf("expected recovered panic value %q, got %v", "boom", recovered)
+	}
+	if stackLen == 0 {
+		t.Fatal("expected a non-empty stack trace")
+	}
+}
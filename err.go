@@ -0,0 +1,57 @@
+package ctxhelper
+
+import (
+	"errors"
+	"sync"
+)
+
+// errs collects errors returned by OnDoneErr registrations, joined via
+// errors.Join once shutdown completes.
+type errs struct {
+	mu  sync.Mutex
+	all []error
+}
+
+func (e *errs) add(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.all = append(e.all, err)
+}
+
+func (e *errs) join() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return errors.Join(e.all...)
+}
+
+// OnDoneErr behaves like OnDone, but fn may return an error. Any error is
+// collected and surfaced by WaitErr, CancelAndWaitErr and Close once
+// shutdown completes. As with OnDone, execution order across
+// registrations is unspecified, and fn is registered in phase 0, so it
+// participates in the same phase-0 barrier as every other phase-0
+// registration; see OnDonePhase.
+func (h *H) OnDoneErr(fn func() error) {
+	if h.IsDone() || h.IsQuit() {
+		return
+	}
+	h.addPhase(0, func() {
+		if err := fn(); err != nil {
+			h.errs.add(err)
+		}
+	})
+}
+
+// WaitErr waits like Wait, then returns all errors collected from
+// OnDoneErr registrations, joined via errors.Join. It returns nil if none
+// of them returned an error.
+func (h *H) WaitErr() error {
+	h.Wait()
+	return h.errs.join()
+}
+
+// CancelAndWaitErr cancels ctx, waits like CancelAndWait, then returns all
+// errors collected from OnDoneErr registrations, joined via errors.Join.
+func (h *H) CancelAndWaitErr() error {
+	h.Cancel()
+	return h.WaitErr()
+}
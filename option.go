@@ -0,0 +1,29 @@
+package ctxhelper
+
+import "log"
+
+// Option configures H at construction time. See New.
+type Option func(*H)
+
+// WithPanicHandler sets the handler that H forwards panics raised by
+// registered callbacks to once it has recovered them, passing the recovered
+// value and the stack captured at the point of the panic (via
+// runtime/debug.Stack) to handler. handler runs on the goroutine that was
+// executing the callback; wg.Done is still called afterwards, so Wait
+// cannot deadlock because of a panicking callback.
+//
+// If handler itself needs the panic to be fatal, it can re-panic, for
+// example on a dedicated goroutine so the rest of H's bookkeeping still
+// completes.
+//
+// Without this option, H recovers panics the same way, but logs them via
+// log.Printf instead of invoking a handler.
+func WithPanicHandler(handler func(recovered any, stack []byte)) Option {
+	return func(h *H) {
+		h.panicHandler = handler
+	}
+}
+
+func defaultPanicHandler(recovered any, stack []byte) {
+	log.Printf("ctxhelper: recovered panic in callback: %v\n%s", recovered, stack)
+}
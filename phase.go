@@ -0,0 +1,94 @@
+package ctxhelper
+
+import "sync"
+
+// OnDonePhase behaves like OnDone, but assigns fn to phase. Once ctx is
+// canceled (or Quit is called, in which case fn never runs either way),
+// CancelAndWait and Wait run callbacks in ascending phase order, waiting
+// for every callback registered in a phase to finish before any callback
+// in a later phase starts. Within a phase, callbacks still run
+// concurrently with no predetermined order, exactly like OnDone.
+//
+// OnDonePhase is useful for expressing shutdown dependencies, such as
+// closing HTTP servers (phase 0) before closing a database pool
+// (phase 1).
+func (h *H) OnDonePhase(phase int, fn func()) {
+	if h.IsDone() || h.IsQuit() {
+		return
+	}
+	h.addPhase(phase, fn)
+}
+
+// addPhase joins phase's WaitGroup and registers fn through add, wrapping
+// it so it waits for earlier phases to drain first. It returns add's
+// cancel handle so callers that need one (OnDoneCancel) or that wrap fn
+// further (OnDoneErr) can still participate in phase ordering, the same
+// way OnDone and OnDonePhase do.
+func (h *H) addPhase(phase int, fn func()) (cancel func() bool) {
+	h.phaseMu.Lock()
+	wg, ok := h.phaseWG[phase]
+	if !ok {
+		wg = &sync.WaitGroup{}
+		h.phaseWG[phase] = wg
+	}
+	wg.Add(1)
+	h.phaseMu.Unlock()
+
+	stop := h.add(func() {
+		defer h.phaseDone(phase)
+		h.awaitEarlierPhases(phase)
+		fn()
+	})
+	return func() bool {
+		// A prevented registration never runs its wrapper, so release its
+		// slot in phase here; otherwise later phases would wait forever.
+		if stop() {
+			h.phaseDone(phase)
+			return true
+		}
+		return false
+	}
+}
+
+// phaseDone marks one registration of phase as finished.
+func (h *H) phaseDone(phase int) {
+	h.phaseMu.Lock()
+	wg := h.phaseWG[phase]
+	h.phaseMu.Unlock()
+	wg.Done()
+}
+
+// awaitEarlierPhases blocks until every phase registered below phase has
+// fully drained.
+func (h *H) awaitEarlierPhases(phase int) {
+	h.phaseMu.Lock()
+	earlier := make([]*sync.WaitGroup, 0, len(h.phaseWG))
+	for p, wg := range h.phaseWG {
+		if p < phase {
+			earlier = append(earlier, wg)
+		}
+	}
+	h.phaseMu.Unlock()
+
+	for _, wg := range earlier {
+		wg.Wait()
+	}
+}
+
+// Phase is a handle bound to a single shutdown phase of H, letting call
+// sites register phased callbacks without repeating the phase number.
+// Obtain one with H.Phase.
+type Phase struct {
+	h     *H
+	phase int
+}
+
+// Phase returns a handle for registering callbacks in phase on h.
+func (h *H) Phase(phase int) Phase {
+	return Phase{h: h, phase: phase}
+}
+
+// OnDone registers fn in p's phase. See H.OnDonePhase.
+func (p Phase) OnDone(fn func()) {
+	p.h.OnDonePhase(p.phase, fn)
+}
@@ -0,0 +1,36 @@
+//go:build go1.21
+
+package ctxhelper
+
+import "context"
+
+// register arranges for fn to run once h.ctx is done, using
+// context.AfterFunc so idle registrations cost no goroutine. The returned
+// cancel is tracked by the registry in registry.go, so Quit can still
+// call it to prevent fn from running at all.
+//
+// Unlike context.AfterFunc's own stop, the cancel returned here also
+// accounts for h.wg: since wrapped (and its wg.Done) only ever runs if
+// AfterFunc actually invokes it, cancel calls wg.Done itself whenever it
+// prevents that from happening, so wg.Done is always called exactly once
+// per registration regardless of how it resolves.
+func (h *H) register(fn func()) (cancel func() bool) {
+	var stop func() bool
+	stop = context.AfterFunc(h.ctx, func() {
+		defer h.wg.Done()
+		select {
+		case <-h.quitch:
+			return
+		default:
+		}
+		fn()
+	})
+
+	return func() bool {
+		prevented := stop()
+		if prevented {
+			h.wg.Done()
+		}
+		return prevented
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !go1.21
+
+package ctxhelper
+
+import "sync/atomic"
+
+// register arranges for fn to run once h.ctx is done, by parking a
+// dedicated goroutine selecting on h.ctx.Done, h.quitch and a
+// per-registration stop channel. This is the fallback used on
+// toolchains older than Go 1.21, where context.AfterFunc is not
+// available.
+//
+// The goroutine always calls wg.Done exactly once on exit, so the
+// returned cancel never needs to account for wg itself: it only reports
+// whether it managed to stop fn from running.
+//
+// Whether fn runs is decided by a single CompareAndSwap on stopped,
+// shared by the goroutine and cancel: whichever of them wins it is
+// authoritative, so there's no window where cancel can report true after
+// the goroutine has already committed to calling fn.
+func (h *H) register(fn func()) (cancel func() bool) {
+	stopch := make(chan struct{})
+	var stopped atomic.Bool
+
+	go func() {
+		defer h.wg.Done()
+		select {
+		case <-h.ctx.Done(): // wait for context cancellation
+		case <-h.quitch:
+			return
+		case <-stopch:
+			return
+		}
+		if !stopped.CompareAndSwap(false, true) {
+			return
+		}
+		fn()
+	}()
+
+	return func() bool {
+		if stopped.CompareAndSwap(false, true) {
+			close(stopch)
+			return true
+		}
+		return false
+	}
+}
@@ -0,0 +1,77 @@
+package ctxhelper
+
+import "runtime/debug"
+
+// add registers fn with register, tracking it under an incrementing id so
+// it can be looked up and removed independently of any other
+// registration. It returns a cancel function that removes fn's entry and
+// reports whether it prevented fn from running.
+func (h *H) add(fn func()) (cancel func() bool) {
+	h.wg.Add(1)
+
+	h.regMu.Lock()
+	id := h.nextID
+	h.nextID++
+	h.regMu.Unlock()
+
+	stop := h.register(func() {
+		defer h.removeReg(id)
+		h.safeCall(fn)
+	})
+
+	h.regMu.Lock()
+	h.regs[id] = stop
+	h.regMu.Unlock()
+
+	return func() bool { return h.cancelReg(id) }
+}
+
+// cancelReg removes id's entry, if it's still present, and calls its
+// underlying stop. It reports whether stop prevented fn from running,
+// the same way the cancel returned by add does.
+func (h *H) cancelReg(id uint64) bool {
+	h.regMu.Lock()
+	stop, ok := h.regs[id]
+	delete(h.regs, id)
+	h.regMu.Unlock()
+	if !ok {
+		return false
+	}
+	return stop()
+}
+
+// removeReg drops id's entry once its registration has run, so the
+// registry doesn't grow unbounded over the lifetime of H.
+func (h *H) removeReg(id uint64) {
+	h.regMu.Lock()
+	delete(h.regs, id)
+	h.regMu.Unlock()
+}
+
+// cancelAll cancels every registration still tracked in the registry,
+// used by Quit so a registration pending when Quit runs doesn't leak its
+// entry for the lifetime of H.
+func (h *H) cancelAll() {
+	h.regMu.Lock()
+	ids := make([]uint64, 0, len(h.regs))
+	for id := range h.regs {
+		ids = append(ids, id)
+	}
+	h.regMu.Unlock()
+
+	for _, id := range ids {
+		h.cancelReg(id)
+	}
+}
+
+// safeCall runs fn, recovering any panic and forwarding it to h's
+// configured panic handler so a misbehaving callback cannot crash the
+// process or leave h.wg permanently incremented.
+func (h *H) safeCall(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.panicHandler(r, debug.Stack())
+		}
+	}()
+	fn()
+}